@@ -0,0 +1,283 @@
+//go:build linux
+
+package efd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// Channel is a shared-memory region opened at runtime rather than at
+// Start time: ShmParent.OpenChannel creates a fresh eventfd+memfd pair and
+// hands it to the already-running child over the control socket via
+// SCM_RIGHTS, so callers don't have to pre-size a giant global P2C/C2P
+// region for things like per-request scratch buffers or on-demand
+// large-object transfer.
+type Channel struct {
+	name string
+	size int
+
+	transport Transport
+	shm       []byte
+}
+
+// Write copies data into the channel's shared region and signals the
+// peer. Like ShmParent's P2C channel, callers must not call Write
+// concurrently with another Write on the same Channel.
+func (ch *Channel) Write(data []byte) error {
+	if len(data) > ch.size {
+		return fmt.Errorf("efd: channel %q: data too large for %d-byte region", ch.name, ch.size)
+	}
+	copy(ch.shm, data)
+	return ch.transport.Signal(uint64(len(data)))
+}
+
+// Read blocks until the peer signals data is ready and returns it.
+func (ch *Channel) Read() ([]byte, error) {
+	n, err := ch.transport.Wait()
+	if err != nil {
+		return nil, err
+	}
+	if int(n) > ch.size {
+		return nil, fmt.Errorf("efd: channel %q: received length %d exceeds %d-byte region", ch.name, n, ch.size)
+	}
+	data := make([]byte, n)
+	copy(data, ch.shm[:n])
+	return data, nil
+}
+
+// Close releases the channel's transport. It does not notify the peer;
+// use ShmParent.CloseChannel for a graceful, coordinated close.
+func (ch *Channel) Close() error {
+	return ch.transport.Close()
+}
+
+// Control message types sent over the socketpair created by
+// attachControlSocket.
+const (
+	controlOpenChannel  byte = 1
+	controlCloseChannel byte = 2
+)
+
+func newControlSocketPair() (parent, child *os.File, err error) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create control socketpair: %w", err)
+	}
+	return os.NewFile(uintptr(fds[0]), "efd_control_parent"),
+		os.NewFile(uintptr(fds[1]), "efd_control_child"), nil
+}
+
+// attachControlSocket creates the control socketpair, keeps the parent's
+// end, and passes the child's end down via ExtraFiles alongside the
+// P2C/C2P channels. Called from Start, before cmd.Start.
+func (p *ShmParent) attachControlSocket() error {
+	parentSock, childSock, err := newControlSocketPair()
+	if err != nil {
+		return err
+	}
+
+	p.controlFile = parentSock
+	p.channels = make(map[string]*Channel)
+
+	p.cmd.ExtraFiles = append(p.cmd.ExtraFiles, childSock)
+	p.cmd.Args = append(p.cmd.Args, "-control-fd", fmt.Sprintf("%d", nextChildFd(p.cmd)-1))
+	return nil
+}
+
+// OpenChannel creates a new named channel at runtime — a fresh eventfd +
+// memfd pair — and hands it to the already-running child over the control
+// socket, rather than through ExtraFiles at Start time.
+func (p *ShmParent) OpenChannel(name string, size int) (*Channel, error) {
+	transport, err := p.opts.newTransport()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create channel transport: %w", err)
+	}
+	shm, err := transport.MapShared(name, size)
+	if err != nil {
+		transport.Close()
+		return nil, fmt.Errorf("failed to map channel shm: %w", err)
+	}
+
+	// PassToChild's contract is "attach FDs to a cmd and describe them";
+	// reuse it against a throwaway Cmd purely to collect the FDs, which
+	// we then pass over the control socket instead of ExtraFiles.
+	carrier := &exec.Cmd{}
+	_ = transport.PassToChild(carrier)
+
+	if err := p.sendControlMessage(controlOpenChannel, name, size, carrier.ExtraFiles); err != nil {
+		transport.Close()
+		return nil, fmt.Errorf("failed to send channel to child: %w", err)
+	}
+
+	ch := &Channel{name: name, size: size, transport: transport, shm: shm}
+	p.chMu.Lock()
+	p.channels[name] = ch
+	p.chMu.Unlock()
+	return ch, nil
+}
+
+// CloseChannel tells the child to close the named channel and closes the
+// parent's side.
+func (p *ShmParent) CloseChannel(name string) error {
+	p.chMu.Lock()
+	ch, ok := p.channels[name]
+	delete(p.channels, name)
+	p.chMu.Unlock()
+	if !ok {
+		return fmt.Errorf("efd: no channel named %q", name)
+	}
+
+	if err := p.sendControlMessage(controlCloseChannel, name, 0, nil); err != nil {
+		return err
+	}
+	return ch.Close()
+}
+
+func (p *ShmParent) sendControlMessage(msgType byte, name string, size int, files []*os.File) error {
+	payload := encodeControlMessage(msgType, name, size)
+
+	var rights []byte
+	if len(files) > 0 {
+		fds := make([]int, len(files))
+		for i, f := range files {
+			fds[i] = int(f.Fd())
+		}
+		rights = unix.UnixRights(fds...)
+	}
+
+	p.controlMu.Lock()
+	err := unix.Sendmsg(int(p.controlFile.Fd()), payload, rights, nil, 0)
+	p.controlMu.Unlock()
+
+	// files is only reachable through the loop above once their fds have
+	// been read into rights; without this, os.File's finalizer could close
+	// the underlying fd concurrently with the Sendmsg call that dup's it
+	// into the child via SCM_RIGHTS.
+	runtime.KeepAlive(files)
+	return err
+}
+
+// AttachControlSocket starts a background goroutine that receives
+// channels opened by ShmParent.OpenChannel on fd and dispatches them by
+// name; use Channel to retrieve one once it has arrived.
+func (c *ShmChild) AttachControlSocket(fd int) error {
+	c.controlFile = os.NewFile(uintptr(fd), "efd_control_child")
+	go c.listenControl()
+	return nil
+}
+
+// Channel blocks until the named channel has been opened by the parent
+// and returns it. It never returns nil: if the channel never arrives (for
+// example, it failed to attach or was closed first), Channel does not
+// return.
+func (c *ShmChild) Channel(name string) *Channel {
+	c.chMu.Lock()
+	defer c.chMu.Unlock()
+	for {
+		if ch, ok := c.channels[name]; ok {
+			return ch
+		}
+		c.chCond.Wait()
+	}
+}
+
+func (c *ShmChild) listenControl() {
+	for {
+		msgType, name, size, files, err := recvControlMessage(c.controlFile)
+		if err != nil {
+			return
+		}
+
+		switch msgType {
+		case controlOpenChannel:
+			fds := make([]int, len(files))
+			for i, f := range files {
+				fds[i] = int(f.Fd())
+			}
+			transport, shm, err := newChildTransport(fds, size)
+			if err != nil {
+				fmt.Printf("efd: failed to attach channel %q: %v\n", name, err)
+				continue
+			}
+
+			c.chMu.Lock()
+			c.channels[name] = &Channel{name: name, size: size, transport: transport, shm: shm}
+			c.chCond.Broadcast()
+			c.chMu.Unlock()
+
+		case controlCloseChannel:
+			c.chMu.Lock()
+			ch := c.channels[name]
+			delete(c.channels, name)
+			c.chMu.Unlock()
+			if ch != nil {
+				ch.Close()
+			}
+		}
+	}
+}
+
+func encodeControlMessage(msgType byte, name string, size int) []byte {
+	buf := make([]byte, 2+len(name)+4)
+	buf[0] = msgType
+	buf[1] = byte(len(name))
+	copy(buf[2:], name)
+	binary.BigEndian.PutUint32(buf[2+len(name):], uint32(size))
+	return buf
+}
+
+func decodeControlMessage(buf []byte) (msgType byte, name string, size int, err error) {
+	if len(buf) < 2 {
+		return 0, "", 0, fmt.Errorf("efd: control message shorter than header")
+	}
+	msgType = buf[0]
+	nameLen := int(buf[1])
+	if len(buf) < 2+nameLen+4 {
+		return 0, "", 0, fmt.Errorf("efd: control message too short for name+size")
+	}
+	name = string(buf[2 : 2+nameLen])
+	size = int(binary.BigEndian.Uint32(buf[2+nameLen:]))
+	return msgType, name, size, nil
+}
+
+// recvControlMessage blocks for the next control datagram on f, parsing
+// out any SCM_RIGHTS fds alongside the (msgType, name, size) payload.
+func recvControlMessage(f *os.File) (msgType byte, name string, size int, files []*os.File, err error) {
+	buf := make([]byte, 256)
+	oob := make([]byte, unix.CmsgSpace(16*4))
+
+	fd := int(f.Fd())
+	n, oobn, _, _, err := unix.Recvmsg(fd, buf, oob, 0)
+	if err != nil {
+		return 0, "", 0, nil, err
+	}
+
+	msgType, name, size, err = decodeControlMessage(buf[:n])
+	if err != nil {
+		return 0, "", 0, nil, err
+	}
+
+	if oobn > 0 {
+		cmsgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			return 0, "", 0, nil, fmt.Errorf("failed to parse control message: %w", err)
+		}
+		for _, cmsg := range cmsgs {
+			fds, err := unix.ParseUnixRights(&cmsg)
+			if err != nil {
+				continue
+			}
+			for _, rfd := range fds {
+				files = append(files, os.NewFile(uintptr(rfd), "efd_channel"))
+			}
+		}
+	}
+
+	return msgType, name, size, files, nil
+}
@@ -0,0 +1,35 @@
+//go:build !linux
+
+package efd
+
+import "fmt"
+
+// Channel is the handle to a dynamically opened channel; see
+// ShmParent.OpenChannel. Only implemented on Linux today — the BSD/Windows
+// Transports don't yet have an SCM_RIGHTS-equivalent runtime handoff.
+type Channel struct{}
+
+// Close is a no-op placeholder; see the doc on the Channel type.
+func (ch *Channel) Close() error { return nil }
+
+func (p *ShmParent) attachControlSocket() error { return nil }
+
+// OpenChannel is not yet implemented on this platform.
+func (p *ShmParent) OpenChannel(name string, size int) (*Channel, error) {
+	return nil, fmt.Errorf("efd: dynamic channels are not yet supported on this platform")
+}
+
+// CloseChannel is not yet implemented on this platform.
+func (p *ShmParent) CloseChannel(name string) error {
+	return fmt.Errorf("efd: dynamic channels are not yet supported on this platform")
+}
+
+// AttachControlSocket is not yet implemented on this platform.
+func (c *ShmChild) AttachControlSocket(fd int) error {
+	return fmt.Errorf("efd: dynamic channels are not yet supported on this platform")
+}
+
+// Channel is not yet implemented on this platform; it always returns nil.
+func (c *ShmChild) Channel(name string) *Channel {
+	return nil
+}
@@ -0,0 +1,70 @@
+//go:build linux
+
+package efd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeDecodeControlMessageRoundTrip(t *testing.T) {
+	buf := encodeControlMessage(controlOpenChannel, "scratch", 4096)
+
+	msgType, name, size, err := decodeControlMessage(buf)
+	if err != nil {
+		t.Fatalf("decodeControlMessage: %v", err)
+	}
+	if msgType != controlOpenChannel {
+		t.Errorf("msgType = %d, want %d", msgType, controlOpenChannel)
+	}
+	if name != "scratch" {
+		t.Errorf("name = %q, want %q", name, "scratch")
+	}
+	if size != 4096 {
+		t.Errorf("size = %d, want 4096", size)
+	}
+}
+
+func TestDecodeControlMessageRejectsShortBuffer(t *testing.T) {
+	if _, _, _, err := decodeControlMessage([]byte{1}); err == nil {
+		t.Fatal("decodeControlMessage: expected error for a too-short buffer, got nil")
+	}
+}
+
+func TestDecodeControlMessageRejectsTruncatedSize(t *testing.T) {
+	buf := encodeControlMessage(controlCloseChannel, "name", 0)
+	if _, _, _, err := decodeControlMessage(buf[:len(buf)-2]); err == nil {
+		t.Fatal("decodeControlMessage: expected error for a buffer truncated before the size field, got nil")
+	}
+}
+
+func TestChannelWriteRead(t *testing.T) {
+	shm := make([]byte, 64)
+	tr := newFakeTransport()
+	tr.shm = shm
+	ch := &Channel{name: "test", size: len(shm), transport: tr, shm: shm}
+
+	want := []byte("hello channel")
+	if err := ch.Write(want); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	got, err := ch.Read()
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("Read = %q, want %q", got, want)
+	}
+}
+
+func TestChannelWriteRejectsOversizedPayload(t *testing.T) {
+	shm := make([]byte, 4)
+	tr := newFakeTransport()
+	tr.shm = shm
+	ch := &Channel{name: "test", size: len(shm), transport: tr, shm: shm}
+
+	if err := ch.Write([]byte("too big")); err == nil {
+		t.Fatal("Write: expected error for a payload larger than the channel region, got nil")
+	}
+}
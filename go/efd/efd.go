@@ -1,126 +1,135 @@
 package efd
 
 import (
-	"encoding/binary"
 	"fmt"
 	"os"
 	"os/exec"
-
-	"golang.org/x/sys/unix"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-// ShmParent manages the child process, eventfd, and shared memory.
+// frameSlot returns the byte offset of the physical slot assigned to the
+// seq-th frame (1-indexed) sent over a shm region sized shmSize*credits, so
+// that up to credits frames can be in flight at once without one
+// overwriting another before the peer has read it.
+func frameSlot(seq uint64, credits, shmSize int) int {
+	return int((seq-1)%uint64(credits)) * shmSize
+}
+
+// ShmParent manages the child process and the four Transports backing the
+// P2C/C2P data+ack channels. Signaling and shared memory are delegated to
+// a Transport (eventfd+memfd on Linux by default; see WithTransport for
+// other backends), so ShmParent itself has no OS-specific code.
 type ShmParent struct {
 	childPath string
 	shmSize   int
-
-	// Resources
-	efdP2CSend int
-	efdP2CAck  int
-	memfdP2C   int
-	shmP2CPtr  []byte
-
-	efdC2PSend int
-	efdC2PAck  int
-	memfdC2P   int
-	shmC2PPtr  []byte
+	opts      *shmOptions
+
+	p2cData Transport
+	p2cAck  Transport
+	c2pData Transport
+	c2pAck  Transport
+
+	p2cShm []byte
+	c2pShm []byte
+
+	p2cSeq uint64
+
+	// Credit-based flow control (see the Credits option). credits is the
+	// window size N agreed with the child; p2cCredits is how many more
+	// P2C frames SendFrame can send before it must block on p2cAck.Wait
+	// for the next batch; c2pPending is how many C2P frames RecvFrame has
+	// taken without yet returning a credit batch to the child.
+	//
+	// A window wider than one frame means more than one frame can be in
+	// flight at once, so p2cShm/c2pShm are each sized for credits physical
+	// slots (see frameSlot) rather than a single reused buffer; c2pRecvSeq
+	// and c2pAvail track RecvFrame's position in that slot ring across
+	// calls, the mirror of p2cSeq on the send side.
+	credits    int
+	p2cCredits int
+	c2pPending int
+	c2pRecvSeq uint64
+	c2pAvail   uint64
+
+	// Dynamic channels opened at runtime over the control socket, after
+	// Start, rather than at Start time via ExtraFiles. See OpenChannel.
+	controlFile *os.File
+	controlMu   sync.Mutex
+	chMu        sync.Mutex
+	channels    map[string]*Channel
 
 	cmd *exec.Cmd
-
-	fileP2CSend *os.File
-	fileP2CAck  *os.File
-	fileP2CShm  *os.File
-
-	fileC2PSend *os.File
-	fileC2PAck  *os.File
-	fileC2PShm  *os.File
 }
 
-// NewShmParent creates a new ShmParent instance.
-func NewShmParent(childPath string, shmSize int) *ShmParent {
+// NewShmParent creates a new ShmParent instance. By default it uses the
+// current platform's Transport; pass WithTransport to override it.
+func NewShmParent(childPath string, shmSize int, opts ...Option) *ShmParent {
+	o := defaultShmOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
 	return &ShmParent{
 		childPath: childPath,
 		shmSize:   shmSize,
+		opts:      o,
 	}
 }
 
 // Start launches the child process and sets up resources.
 func (p *ShmParent) Start() error {
 	var err error
-	// 1. Create P2C resources
-	p.efdP2CSend, err = unix.Eventfd(0, 0)
-	if err != nil {
-		return fmt.Errorf("failed to create efdP2CSend: %w", err)
-	}
-	p.efdP2CAck, err = unix.Eventfd(0, 0)
-	if err != nil {
-		return fmt.Errorf("failed to create efdP2CAck: %w", err)
-	}
-	p.memfdP2C, err = unix.MemfdCreate("efdstream_shm_p2c", 0)
-	if err != nil {
-		return fmt.Errorf("failed to create memfdP2C: %w", err)
+
+	if p.p2cData, err = p.opts.newTransport(); err != nil {
+		return fmt.Errorf("failed to create p2c data transport: %w", err)
 	}
-	if err := unix.Ftruncate(p.memfdP2C, int64(p.shmSize)); err != nil {
-		return fmt.Errorf("failed to ftruncate memfdP2C: %w", err)
+	if p.p2cShm, err = p.p2cData.MapShared("efdstream_shm_p2c", p.shmSize*p.opts.credits); err != nil {
+		return fmt.Errorf("failed to map p2c shm: %w", err)
 	}
-	p.shmP2CPtr, err = unix.Mmap(p.memfdP2C, 0, p.shmSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
-	if err != nil {
-		return fmt.Errorf("failed to mmap P2C: %w", err)
+	if p.p2cAck, err = p.opts.newTransport(); err != nil {
+		return fmt.Errorf("failed to create p2c ack transport: %w", err)
 	}
 
-	// 2. Create C2P resources
-	p.efdC2PSend, err = unix.Eventfd(0, 0)
-	if err != nil {
-		return fmt.Errorf("failed to create efdC2PSend: %w", err)
-	}
-	p.efdC2PAck, err = unix.Eventfd(0, 0)
-	if err != nil {
-		return fmt.Errorf("failed to create efdC2PAck: %w", err)
-	}
-	p.memfdC2P, err = unix.MemfdCreate("efdstream_shm_c2p", 0)
-	if err != nil {
-		return fmt.Errorf("failed to create memfdC2P: %w", err)
+	if p.c2pData, err = p.opts.newTransport(); err != nil {
+		return fmt.Errorf("failed to create c2p data transport: %w", err)
 	}
-	if err := unix.Ftruncate(p.memfdC2P, int64(p.shmSize)); err != nil {
-		return fmt.Errorf("failed to ftruncate memfdC2P: %w", err)
+	if p.c2pShm, err = p.c2pData.MapShared("efdstream_shm_c2p", p.shmSize*p.opts.credits); err != nil {
+		return fmt.Errorf("failed to map c2p shm: %w", err)
 	}
-	p.shmC2PPtr, err = unix.Mmap(p.memfdC2P, 0, p.shmSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
-	if err != nil {
-		return fmt.Errorf("failed to mmap C2P: %w", err)
+	if p.c2pAck, err = p.opts.newTransport(); err != nil {
+		return fmt.Errorf("failed to create c2p ack transport: %w", err)
 	}
 
-	// Wrap in os.File for ExtraFiles
-	p.fileP2CSend = os.NewFile(uintptr(p.efdP2CSend), "efd_p2c_send")
-	p.fileP2CAck = os.NewFile(uintptr(p.efdP2CAck), "efd_p2c_ack")
-	p.fileP2CShm = os.NewFile(uintptr(p.memfdP2C), "efd_p2c_shm")
-
-	p.fileC2PSend = os.NewFile(uintptr(p.efdC2PSend), "efd_c2p_send")
-	p.fileC2PAck = os.NewFile(uintptr(p.efdC2PAck), "efd_c2p_ack")
-	p.fileC2PShm = os.NewFile(uintptr(p.memfdC2P), "efd_c2p_shm")
-
-	// Prepare command
-	// We map the FDs to 3, 4, 5, 6, 7, 8 in the child process.
-	// ExtraFiles[0] -> FD 3
-	// ExtraFiles[1] -> FD 4
-	// ...
 	p.cmd = exec.Command(p.childPath,
 		"-mode", "child",
-		"-fd-p2c-send", "3",
-		"-fd-p2c-ack", "4",
-		"-fd-p2c-shm", "5",
-		"-fd-c2p-send", "6",
-		"-fd-c2p-ack", "7",
-		"-fd-c2p-shm", "8",
 		"-shm-size", fmt.Sprintf("%d", p.shmSize),
 	)
 	p.cmd.Stdout = os.Stdout
 	p.cmd.Stderr = os.Stderr
 
-	// Pass FDs. ExtraFiles starts at 3.
-	// Order: P2C_Send, P2C_Ack, P2C_Shm, C2P_Send, C2P_Ack, C2P_Shm
-	p.cmd.ExtraFiles = []*os.File{
-		p.fileP2CSend, p.fileP2CAck, p.fileP2CShm,
-		p.fileC2PSend, p.fileC2PAck, p.fileC2PShm,
+	// Each PassToChild call appends whatever FDs/handles that Transport
+	// owns to p.cmd, so these must run before Start and in a fixed order
+	// the child parses the same way.
+	p.cmd.Args = append(p.cmd.Args,
+		"-p2c-data", strings.Join(p.p2cData.PassToChild(p.cmd), ","),
+		"-p2c-ack", strings.Join(p.p2cAck.PassToChild(p.cmd), ","),
+		"-c2p-data", strings.Join(p.c2pData.PassToChild(p.cmd), ","),
+		"-c2p-ack", strings.Join(p.c2pAck.PassToChild(p.cmd), ","),
+		"-credits", fmt.Sprintf("%d", p.opts.credits),
+	)
+
+	// The child starts out owing us nothing, so we start with a full
+	// window of P2C sends available before SendFrame has to block
+	// waiting for the child to grant a batch back.
+	p.credits = p.opts.credits
+	p.p2cCredits = p.opts.credits
+
+	// attachControlSocket wires up the SOCK_SEQPACKET pair OpenChannel
+	// needs to hand new channels to the child after Start; it's a no-op
+	// where the platform doesn't support it yet.
+	if err := p.attachControlSocket(); err != nil {
+		return fmt.Errorf("failed to attach control socket: %w", err)
 	}
 
 	if err := p.cmd.Start(); err != nil {
@@ -130,65 +139,91 @@ func (p *ShmParent) Start() error {
 	return nil
 }
 
-// SendData sends data to the child (P2C).
-func (p *ShmParent) SendData(data []byte) error {
-	if len(data) > p.shmSize {
-		return fmt.Errorf("data too large")
+// SendFrame sends a framed message of the given type to the child (P2C). If
+// the outstanding credit window is exhausted, it first blocks for the child
+// to grant a fresh batch via ListenFrames; with the default Credits(1) this
+// reproduces the original strict send-then-ack behavior.
+//
+// Each frame is written into its own physical slot in p2cShm, indexed by
+// sequence number (see frameSlot), rather than a single reused buffer, so
+// up to credits frames can be outstanding at once without one overwriting
+// another before the child has read it. Signal carries a frame count, not
+// a byte length, which RecvFrame/ListenFrames accumulate across calls.
+func (p *ShmParent) SendFrame(msgType uint16, payload []byte) error {
+	n := frameHeaderLen + len(payload)
+	if n > p.shmSize {
+		return fmt.Errorf("frame too large for shm region")
 	}
 
-	// Write to SHM
-	copy(p.shmP2CPtr, data)
-
-	// Signal
-	lenBuf := make([]byte, 8)
-	binary.LittleEndian.PutUint64(lenBuf, uint64(len(data)))
-	if _, err := p.fileP2CSend.Write(lenBuf); err != nil {
-		return err
+	if p.p2cCredits == 0 {
+		granted, err := p.p2cAck.Wait()
+		if err != nil {
+			return err
+		}
+		p.p2cCredits = int(granted)
 	}
 
-	// Wait for ACK
-	ackBuf := make([]byte, 8)
-	if _, err := p.fileP2CAck.Read(ackBuf); err != nil {
+	seq := atomic.AddUint64(&p.p2cSeq, 1)
+	off := frameSlot(seq, p.credits, p.shmSize)
+	encodeFrame(p.p2cShm[off:off+n], msgType, 0, seq, payload)
+
+	if err := p.p2cData.Signal(1); err != nil {
 		return err
 	}
+	p.p2cCredits--
 
 	return nil
 }
 
-// ReadData reads data from the child (C2P).
-func (p *ShmParent) ReadData() ([]byte, error) {
-	// Wait for Signal
-	lenBuf := make([]byte, 8)
-	if _, err := p.fileC2PSend.Read(lenBuf); err != nil {
-		return nil, err
-	}
-	length := binary.LittleEndian.Uint64(lenBuf)
-
-	if int(length) > p.shmSize {
-		return nil, fmt.Errorf("received length %d exceeds SHM size", length)
+// RecvFrame reads the next framed message from the child (C2P), rejecting
+// it if the magic, version, or CRC don't match rather than trusting the
+// signaled length blindly. It only grants a credit batch back to the child
+// once credits frames have been taken, rather than acking every frame; with
+// the default Credits(1) this grants one credit per frame, matching the
+// original behavior. A credit is granted back even for a rejected frame, so
+// a corrupt frame never permanently shrinks the child's send window.
+func (p *ShmParent) RecvFrame() (Frame, error) {
+	if p.c2pAvail == 0 {
+		n, err := p.c2pData.Wait()
+		if err != nil {
+			return Frame{}, err
+		}
+		p.c2pAvail = n
 	}
 
-	// Read from SHM
-	data := make([]byte, length)
-	copy(data, p.shmC2PPtr[:length])
+	p.c2pRecvSeq++
+	off := frameSlot(p.c2pRecvSeq, p.credits, p.shmSize)
+	frame, decodeErr := decodeFrame(p.c2pShm[off : off+p.shmSize])
+	p.c2pAvail--
 
-	// Send ACK
-	ackBuf := make([]byte, 8)
-	binary.LittleEndian.PutUint64(ackBuf, 1)
-	if _, err := p.fileC2PAck.Write(ackBuf); err != nil {
-		return nil, err
+	p.c2pPending++
+	if p.c2pPending >= p.credits {
+		if err := p.c2pAck.Signal(uint64(p.c2pPending)); err != nil {
+			return Frame{}, err
+		}
+		p.c2pPending = 0
 	}
 
-	return data, nil
+	if decodeErr != nil {
+		return Frame{}, decodeErr
+	}
+	return frame, nil
 }
 
 // Close cleans up resources.
 func (p *ShmParent) Close() {
-	if p.shmP2CPtr != nil {
-		unix.Munmap(p.shmP2CPtr)
+	for _, t := range []Transport{p.p2cData, p.p2cAck, p.c2pData, p.c2pAck} {
+		if t != nil {
+			t.Close()
+		}
+	}
+	p.chMu.Lock()
+	for _, ch := range p.channels {
+		ch.Close()
 	}
-	if p.shmC2PPtr != nil {
-		unix.Munmap(p.shmC2PPtr)
+	p.chMu.Unlock()
+	if p.controlFile != nil {
+		p.controlFile.Close()
 	}
 	if p.cmd != nil && p.cmd.Process != nil {
 		p.cmd.Process.Kill()
@@ -197,114 +232,174 @@ func (p *ShmParent) Close() {
 
 // ShmChild manages the child side of the connection.
 type ShmChild struct {
-	fdP2CSend int
-	fdP2CAck  int
-	fdP2CShm  int
-	fdC2PSend int
-	fdC2PAck  int
-	fdC2PShm  int
-	shmSize   int
+	shmSize int
+
+	p2cData Transport
+	p2cAck  Transport
+	c2pData Transport
+	c2pAck  Transport
+
+	p2cShm []byte
+	c2pShm []byte
+
+	c2pSeq uint64
+
+	// Credit-based flow control (see the Credits option), mirroring
+	// ShmParent: credits is the window size N agreed with the parent;
+	// c2pCredits is how many more C2P frames SendFrame can send before it
+	// must block on c2pAck.Wait for the next batch; p2cPending is how
+	// many P2C frames ListenFrames has taken without yet granting a
+	// credit batch back to the parent.
+	credits    int
+	c2pCredits int
+	p2cPending int
+
+	// Dynamic channels received at runtime over the control socket. See
+	// AttachControlSocket.
+	controlFile *os.File
+	chMu        sync.Mutex
+	chCond      *sync.Cond
+	channels    map[string]*Channel
+}
 
-	shmP2CPtr []byte
-	shmC2PPtr []byte
+// NewShmChild reconstructs the four Transports a ShmParent passed down.
+// Each fds slice is the comma-separated flag value ShmParent.Start built
+// from the matching Transport's PassToChild, parsed back into ints by the
+// caller. credits is the -credits flag value ShmParent.Start passed down,
+// and must match the window size the parent was constructed with.
+func NewShmChild(p2cData, p2cAck, c2pData, c2pAck []int, shmSize, credits int) (*ShmChild, error) {
+	c := &ShmChild{shmSize: shmSize, credits: credits, c2pCredits: credits, channels: make(map[string]*Channel)}
+	c.chCond = sync.NewCond(&c.chMu)
 
-	fileP2CSend *os.File
-	fileP2CAck  *os.File
-	fileC2PSend *os.File
-	fileC2PAck  *os.File
-}
+	var err error
+	var t Transport
 
-// NewShmChild creates a new ShmChild instance.
-func NewShmChild(fdP2CSend, fdP2CAck, fdP2CShm, fdC2PSend, fdC2PAck, fdC2PShm, shmSize int) (*ShmChild, error) {
-	c := &ShmChild{
-		fdP2CSend: fdP2CSend,
-		fdP2CAck:  fdP2CAck,
-		fdP2CShm:  fdP2CShm,
-		fdC2PSend: fdC2PSend,
-		fdC2PAck:  fdC2PAck,
-		fdC2PShm:  fdC2PShm,
-		shmSize:   shmSize,
+	if t, c.p2cShm, err = newChildTransport(p2cData, shmSize*credits); err != nil {
+		return nil, fmt.Errorf("failed to attach p2c data transport: %w", err)
 	}
+	c.p2cData = t
 
-	var err error
-	// Mmap P2C (Read)
-	c.shmP2CPtr, err = unix.Mmap(c.fdP2CShm, 0, c.shmSize, unix.PROT_READ, unix.MAP_SHARED)
-	if err != nil {
-		return nil, fmt.Errorf("failed to mmap P2C: %w", err)
+	if t, _, err = newChildTransport(p2cAck, 0); err != nil {
+		return nil, fmt.Errorf("failed to attach p2c ack transport: %w", err)
 	}
+	c.p2cAck = t
 
-	// Mmap C2P (Write)
-	c.shmC2PPtr, err = unix.Mmap(c.fdC2PShm, 0, c.shmSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
-	if err != nil {
-		return nil, fmt.Errorf("failed to mmap C2P: %w", err)
+	if t, c.c2pShm, err = newChildTransport(c2pData, shmSize*credits); err != nil {
+		return nil, fmt.Errorf("failed to attach c2p data transport: %w", err)
 	}
+	c.c2pData = t
 
-	c.fileP2CSend = os.NewFile(uintptr(c.fdP2CSend), "efd_p2c_send")
-	c.fileP2CAck = os.NewFile(uintptr(c.fdP2CAck), "efd_p2c_ack")
-	c.fileC2PSend = os.NewFile(uintptr(c.fdC2PSend), "efd_c2p_send")
-	c.fileC2PAck = os.NewFile(uintptr(c.fdC2PAck), "efd_c2p_ack")
+	if t, _, err = newChildTransport(c2pAck, 0); err != nil {
+		return nil, fmt.Errorf("failed to attach c2p ack transport: %w", err)
+	}
+	c.c2pAck = t
 
 	return c, nil
 }
 
-// Listen reads data from the parent (P2C).
-func (c *ShmChild) Listen(handler func([]byte)) error {
-	lenBuf := make([]byte, 8)
-	ackBuf := make([]byte, 8)
-	binary.LittleEndian.PutUint64(ackBuf, 1)
-
+// ListenFrames reads framed messages from the parent (P2C), rejecting any
+// whose magic, version, or CRC don't match rather than trusting the
+// signaled length blindly. It only grants a credit batch back to the
+// parent once credits frames have been taken (valid or not), rather than
+// acking every frame; with the default Credits(1) this grants one credit
+// per frame, matching the original behavior.
+//
+// Each frame lives in its own physical slot in p2cShm, indexed by sequence
+// number (see frameSlot); avail accumulates the frame count a single
+// Signal/Wait round trip may have coalesced, so a wakeup covering several
+// frames is drained one slot at a time before blocking again.
+func (c *ShmChild) ListenFrames(handler func(Frame)) error {
+	var avail uint64
+	var recvSeq uint64
 	for {
-		if _, err := c.fileP2CSend.Read(lenBuf); err != nil {
-			return err
+		if avail == 0 {
+			n, err := c.p2cData.Wait()
+			if err != nil {
+				return err
+			}
+			avail = n
 		}
-		length := binary.LittleEndian.Uint64(lenBuf)
 
-		if int(length) > c.shmSize {
-			fmt.Printf("Received length %d exceeds SHM size\n", length)
+		recvSeq++
+		off := frameSlot(recvSeq, c.credits, c.shmSize)
+		frame, err := decodeFrame(c.p2cShm[off : off+c.shmSize])
+		avail--
+		if err != nil {
+			fmt.Printf("Discarding invalid frame: %v\n", err)
+			if err := c.grantP2CCredit(); err != nil {
+				return err
+			}
 			continue
 		}
+		handler(frame)
 
-		data := make([]byte, length)
-		copy(data, c.shmP2CPtr[:length])
-		handler(data)
-
-		if _, err := c.fileP2CAck.Write(ackBuf); err != nil {
+		if err := c.grantP2CCredit(); err != nil {
 			return err
 		}
 	}
 }
 
-// SendData sends data to the parent (C2P).
-func (c *ShmChild) SendData(data []byte) error {
-	if len(data) > c.shmSize {
-		return fmt.Errorf("data too large")
+// grantP2CCredit accumulates one taken P2C frame and, once a full window
+// has been taken, signals a single batched credit grant back to the parent.
+func (c *ShmChild) grantP2CCredit() error {
+	c.p2cPending++
+	if c.p2cPending >= c.credits {
+		if err := c.p2cAck.Signal(uint64(c.p2cPending)); err != nil {
+			return err
+		}
+		c.p2cPending = 0
 	}
+	return nil
+}
 
-	// Write to SHM
-	copy(c.shmC2PPtr, data)
+// SendFrame sends a framed message of the given type to the parent (C2P).
+// If the outstanding credit window is exhausted, it first blocks for the
+// parent to grant a fresh batch via RecvFrame; with the default Credits(1)
+// this reproduces the original strict send-then-ack behavior.
+//
+// Each frame is written into its own physical slot in c2pShm, indexed by
+// sequence number (see frameSlot), rather than a single reused buffer, so
+// up to credits frames can be outstanding at once without one overwriting
+// another before the parent has read it.
+func (c *ShmChild) SendFrame(msgType uint16, payload []byte) error {
+	n := frameHeaderLen + len(payload)
+	if n > c.shmSize {
+		return fmt.Errorf("frame too large for shm region")
+	}
 
-	// Signal
-	lenBuf := make([]byte, 8)
-	binary.LittleEndian.PutUint64(lenBuf, uint64(len(data)))
-	if _, err := c.fileC2PSend.Write(lenBuf); err != nil {
-		return err
+	if c.c2pCredits == 0 {
+		granted, err := c.c2pAck.Wait()
+		if err != nil {
+			return err
+		}
+		c.c2pCredits = int(granted)
 	}
 
-	// Wait for ACK
-	ackBuf := make([]byte, 8)
-	if _, err := c.fileC2PAck.Read(ackBuf); err != nil {
+	seq := atomic.AddUint64(&c.c2pSeq, 1)
+	off := frameSlot(seq, c.credits, c.shmSize)
+	encodeFrame(c.c2pShm[off:off+n], msgType, 0, seq, payload)
+
+	if err := c.c2pData.Signal(1); err != nil {
 		return err
 	}
+	c.c2pCredits--
 
 	return nil
 }
 
 // Close cleans up resources.
 func (c *ShmChild) Close() {
-	if c.shmP2CPtr != nil {
-		unix.Munmap(c.shmP2CPtr)
+	for _, t := range []Transport{c.p2cData, c.p2cAck, c.c2pData, c.c2pAck} {
+		if t != nil {
+			t.Close()
+		}
+	}
+	c.chMu.Lock()
+	for _, ch := range c.channels {
+		ch.Close()
 	}
-	if c.shmC2PPtr != nil {
-		unix.Munmap(c.shmC2PPtr)
+	c.chMu.Unlock()
+	if c.controlFile != nil {
+		c.controlFile.Close()
 	}
 }
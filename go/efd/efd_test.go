@@ -0,0 +1,102 @@
+package efd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFrameSlot(t *testing.T) {
+	cases := []struct {
+		seq            uint64
+		credits        int
+		shmSize        int
+		wantSlotOffset int
+	}{
+		{seq: 1, credits: 4, shmSize: 100, wantSlotOffset: 0},
+		{seq: 2, credits: 4, shmSize: 100, wantSlotOffset: 100},
+		{seq: 4, credits: 4, shmSize: 100, wantSlotOffset: 300},
+		{seq: 5, credits: 4, shmSize: 100, wantSlotOffset: 0}, // wraps back to slot 0
+		{seq: 1, credits: 1, shmSize: 64, wantSlotOffset: 0},  // Credits(1): always the one slot
+	}
+
+	for _, c := range cases {
+		if got := frameSlot(c.seq, c.credits, c.shmSize); got != c.wantSlotOffset {
+			t.Errorf("frameSlot(%d, %d, %d) = %d, want %d", c.seq, c.credits, c.shmSize, got, c.wantSlotOffset)
+		}
+	}
+}
+
+// newLoopbackParent builds a ShmParent whose P2C and C2P sides alias the
+// same fake transport and shm buffer, so SendFrame (P2C) followed by
+// RecvFrame (C2P) on the same instance exercises a full send/receive round
+// trip without a real child process or OS shared memory.
+func newLoopbackParent(shmSize, credits int) *ShmParent {
+	data := newFakeTransport()
+	ack := newFakeTransport()
+	shm := make([]byte, shmSize*credits)
+
+	return &ShmParent{
+		shmSize:    shmSize,
+		credits:    credits,
+		p2cCredits: credits,
+		p2cData:    data,
+		p2cAck:     ack,
+		p2cShm:     shm,
+		c2pData:    data,
+		c2pAck:     ack,
+		c2pShm:     shm,
+	}
+}
+
+// TestShmParentMultipleInFlightFramesDontClobber is a regression test for
+// the original credit window bug (fixed alongside frameSlot): SendFrame
+// used to write every frame into the same reused buffer regardless of the
+// credit count, so a second send before the first was read would silently
+// overwrite it.
+func TestShmParentMultipleInFlightFramesDontClobber(t *testing.T) {
+	const credits = 4
+	p := newLoopbackParent(frameHeaderLen+8, credits)
+
+	want := [][]byte{
+		[]byte("frame-0!"),
+		[]byte("frame-1!"),
+		[]byte("frame-2!"),
+		[]byte("frame-3!"),
+	}
+	for i, payload := range want {
+		if err := p.SendFrame(TypeData, payload); err != nil {
+			t.Fatalf("SendFrame %d: %v", i, err)
+		}
+	}
+
+	for i, payload := range want {
+		frame, err := p.RecvFrame()
+		if err != nil {
+			t.Fatalf("RecvFrame %d: %v", i, err)
+		}
+		if !bytes.Equal(frame.Payload, payload) {
+			t.Fatalf("RecvFrame %d payload = %q, want %q", i, frame.Payload, payload)
+		}
+	}
+}
+
+func TestRecvFrameGrantsCreditOnInvalidFrame(t *testing.T) {
+	const credits = 1
+	p := newLoopbackParent(frameHeaderLen+4, credits)
+
+	if err := p.SendFrame(TypeData, []byte("ok!!")); err != nil {
+		t.Fatalf("SendFrame: %v", err)
+	}
+
+	// Corrupt the payload after it was written so the CRC check fails.
+	p.c2pShm[len(p.c2pShm)-1] ^= 0xff
+
+	if _, err := p.RecvFrame(); err == nil {
+		t.Fatal("RecvFrame: expected an error for a corrupted frame, got nil")
+	}
+
+	ack := p.c2pAck.(*fakeTransport)
+	if len(ack.signaled) != 1 {
+		t.Fatalf("credit grants after a rejected frame = %d, want 1 (credit must still be returned)", len(ack.signaled))
+	}
+}
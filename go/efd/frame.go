@@ -0,0 +1,98 @@
+package efd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// frameMagic identifies a valid efd frame. RecvFrame checks it (along
+// with the version and CRC) instead of trusting the signaled length
+// blindly, the way the old bare length-prefix protocol did.
+const frameMagic uint32 = 0x45464453 // "EFDS"
+
+const frameVersion uint8 = 1
+
+// Frame message types. TypeData carries user payloads; the others are
+// control frames that flow over the same channel so either side can
+// manage it (keepalives, an orderly close, or resizing the backing
+// region) without a separate protocol.
+const (
+	TypeData   uint16 = 0
+	TypePing   uint16 = 1
+	TypeClose  uint16 = 2
+	TypeResize uint16 = 3
+)
+
+// frameHeaderLen is the on-wire size of a frame's header:
+// magic(4) + version(1) + flags(1) + msgType(2) + seq(8) + payloadLen(4) + crc32(4).
+const frameHeaderLen = 24
+
+// Frame is a decoded message read from a channel via RecvFrame.
+type Frame struct {
+	Version uint8
+	Flags   uint8
+	Type    uint16
+	Seq     uint64
+	Payload []byte
+}
+
+// encodeFrame writes a frame header followed by payload into buf, which
+// must be at least frameHeaderLen+len(payload) bytes, and returns the
+// total number of bytes written.
+func encodeFrame(buf []byte, msgType uint16, flags uint8, seq uint64, payload []byte) int {
+	binary.BigEndian.PutUint32(buf[0:4], frameMagic)
+	buf[4] = frameVersion
+	buf[5] = flags
+	binary.BigEndian.PutUint16(buf[6:8], msgType)
+	binary.BigEndian.PutUint64(buf[8:16], seq)
+	binary.BigEndian.PutUint32(buf[16:20], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[20:24], crc32.ChecksumIEEE(payload))
+	copy(buf[frameHeaderLen:], payload)
+	return frameHeaderLen + len(payload)
+}
+
+// decodeFrame parses a frame from the start of buf (a whole shm slot; the
+// header's payloadLen says how much of it is the frame), validating magic,
+// version, and CRC.
+func decodeFrame(buf []byte) (Frame, error) {
+	if len(buf) < frameHeaderLen {
+		return Frame{}, fmt.Errorf("efd: frame shorter than header (%d bytes)", len(buf))
+	}
+
+	magic := binary.BigEndian.Uint32(buf[0:4])
+	if magic != frameMagic {
+		return Frame{}, fmt.Errorf("efd: bad frame magic %#x", magic)
+	}
+
+	version := buf[4]
+	if version != frameVersion {
+		return Frame{}, fmt.Errorf("efd: unsupported frame version %d", version)
+	}
+
+	flags := buf[5]
+	msgType := binary.BigEndian.Uint16(buf[6:8])
+	seq := binary.BigEndian.Uint64(buf[8:16])
+	payloadLen := binary.BigEndian.Uint32(buf[16:20])
+	wantCRC := binary.BigEndian.Uint32(buf[20:24])
+
+	if frameHeaderLen+int(payloadLen) > len(buf) {
+		return Frame{}, fmt.Errorf("efd: frame payload length %d exceeds received region", payloadLen)
+	}
+
+	payload := buf[frameHeaderLen : frameHeaderLen+int(payloadLen)]
+	if gotCRC := crc32.ChecksumIEEE(payload); gotCRC != wantCRC {
+		return Frame{}, fmt.Errorf("efd: frame CRC mismatch: got %#x, want %#x", gotCRC, wantCRC)
+	}
+
+	data := make([]byte, payloadLen)
+	copy(data, payload)
+
+	return Frame{
+		Version: version,
+		Flags:   flags,
+		Type:    msgType,
+		Seq:     seq,
+		Payload: data,
+	}, nil
+}
@@ -0,0 +1,81 @@
+package efd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeDecodeFrameRoundTrip(t *testing.T) {
+	payload := []byte("hello, efd")
+	buf := make([]byte, frameHeaderLen+len(payload))
+
+	n := encodeFrame(buf, TypeData, 0, 42, payload)
+	if n != len(buf) {
+		t.Fatalf("encodeFrame returned %d, want %d", n, len(buf))
+	}
+
+	frame, err := decodeFrame(buf)
+	if err != nil {
+		t.Fatalf("decodeFrame: %v", err)
+	}
+	if frame.Version != frameVersion {
+		t.Errorf("Version = %d, want %d", frame.Version, frameVersion)
+	}
+	if frame.Type != TypeData {
+		t.Errorf("Type = %d, want %d", frame.Type, TypeData)
+	}
+	if frame.Seq != 42 {
+		t.Errorf("Seq = %d, want 42", frame.Seq)
+	}
+	if !bytes.Equal(frame.Payload, payload) {
+		t.Errorf("Payload = %q, want %q", frame.Payload, payload)
+	}
+}
+
+func TestDecodeFrameRejectsBadMagic(t *testing.T) {
+	buf := make([]byte, frameHeaderLen)
+	encodeFrame(buf, TypePing, 0, 1, nil)
+	buf[0] ^= 0xff
+
+	if _, err := decodeFrame(buf); err == nil {
+		t.Fatal("decodeFrame: expected error for a corrupted magic, got nil")
+	}
+}
+
+func TestDecodeFrameRejectsBadVersion(t *testing.T) {
+	buf := make([]byte, frameHeaderLen)
+	encodeFrame(buf, TypePing, 0, 1, nil)
+	buf[4] = frameVersion + 1
+
+	if _, err := decodeFrame(buf); err == nil {
+		t.Fatal("decodeFrame: expected error for an unsupported version, got nil")
+	}
+}
+
+func TestDecodeFrameRejectsCRCMismatch(t *testing.T) {
+	payload := []byte("payload")
+	buf := make([]byte, frameHeaderLen+len(payload))
+	encodeFrame(buf, TypeData, 0, 1, payload)
+
+	buf[frameHeaderLen] ^= 0xff // corrupt the payload after the CRC was computed
+
+	if _, err := decodeFrame(buf); err == nil {
+		t.Fatal("decodeFrame: expected error for a CRC mismatch, got nil")
+	}
+}
+
+func TestDecodeFrameRejectsShortBuffer(t *testing.T) {
+	if _, err := decodeFrame(make([]byte, frameHeaderLen-1)); err == nil {
+		t.Fatal("decodeFrame: expected error for a buffer shorter than the header, got nil")
+	}
+}
+
+func TestDecodeFrameRejectsTruncatedPayload(t *testing.T) {
+	payload := []byte("payload")
+	buf := make([]byte, frameHeaderLen+len(payload))
+	encodeFrame(buf, TypeData, 0, 1, payload)
+
+	if _, err := decodeFrame(buf[:frameHeaderLen+2]); err == nil {
+		t.Fatal("decodeFrame: expected error when the buffer is shorter than the declared payload length, got nil")
+	}
+}
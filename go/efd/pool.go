@@ -0,0 +1,225 @@
+//go:build linux
+
+package efd
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// fdWaiter is implemented by Transports that can expose a raw,
+// epoll-pollable descriptor for their wake-up signal. Pool uses it to
+// multiplex many children's C2P channels from one epoll instance instead
+// of blocking in ShmParent.RecvFrame per child.
+type fdWaiter interface {
+	waitFd() int
+}
+
+func (t *eventfdTransport) waitFd() int { return t.efd }
+
+// cancelEventID is the sentinel child ID reserved for Pool's internal
+// cancel eventfd; caller-assigned child IDs must be non-negative.
+const cancelEventID = -1
+
+// Pool manages N child processes started as ShmParent and lets the caller
+// await activity from any of them from a single goroutine, via an epoll
+// instance registered on each child's C2P eventfd.
+//
+// A single EPOLLIN can cover more than one frame: RecvFrame's underlying
+// Wait drains the whole eventfd counter in one read, so with Credits(n>1)
+// a wakeup may leave several already-signaled frames sitting in
+// ShmParent.c2pAvail with nothing left in the eventfd to trigger another
+// epoll event. pending tracks which children Wait left in that state, so
+// the next call drains them directly instead of blocking in epoll_wait for
+// a signal that will never come.
+type Pool struct {
+	epfd     int
+	cancelFd int
+
+	mu       sync.Mutex
+	children map[int]*ShmParent
+	pending  map[int]struct{}
+}
+
+// NewPool creates an empty Pool.
+func NewPool() (*Pool, error) {
+	epfd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create epoll instance: %w", err)
+	}
+
+	cancelFd, err := unix.Eventfd(0, unix.EFD_NONBLOCK)
+	if err != nil {
+		unix.Close(epfd)
+		return nil, fmt.Errorf("failed to create cancel eventfd: %w", err)
+	}
+	if err := unix.EpollCtl(epfd, unix.EPOLL_CTL_ADD, cancelFd, &unix.EpollEvent{
+		Events: unix.EPOLLIN,
+		Fd:     cancelEventID,
+	}); err != nil {
+		unix.Close(epfd)
+		unix.Close(cancelFd)
+		return nil, fmt.Errorf("failed to register cancel eventfd: %w", err)
+	}
+
+	return &Pool{
+		epfd:     epfd,
+		cancelFd: cancelFd,
+		children: make(map[int]*ShmParent),
+		pending:  make(map[int]struct{}),
+	}, nil
+}
+
+// Add starts child and registers it under id. id identifies the child in
+// Wait, SendTo, and Broadcast, and must be non-negative and unique within
+// the pool.
+func (p *Pool) Add(id int, child *ShmParent) error {
+	if id < 0 {
+		return fmt.Errorf("efd: pool child id must be non-negative, got %d", id)
+	}
+
+	if err := child.Start(); err != nil {
+		return fmt.Errorf("failed to start child %d: %w", id, err)
+	}
+
+	waiter, ok := child.c2pData.(fdWaiter)
+	if !ok {
+		child.Close()
+		return fmt.Errorf("efd: pool requires an epoll-pollable transport, got %T", child.c2pData)
+	}
+
+	if err := unix.EpollCtl(p.epfd, unix.EPOLL_CTL_ADD, waiter.waitFd(), &unix.EpollEvent{
+		Events: unix.EPOLLIN,
+		Fd:     int32(id),
+	}); err != nil {
+		child.Close()
+		return fmt.Errorf("failed to register child %d with epoll: %w", id, err)
+	}
+
+	p.mu.Lock()
+	p.children[id] = child
+	p.mu.Unlock()
+	return nil
+}
+
+// Wait blocks until a registered child signals data is ready, or ctx is
+// done, and returns the child's ID and the frame it sent.
+func (p *Pool) Wait(ctx context.Context) (childID int, data []byte, err error) {
+	stop := context.AfterFunc(ctx, func() {
+		var buf [8]byte
+		binary.NativeEndian.PutUint64(buf[:], 1)
+		unix.Write(p.cancelFd, buf[:])
+	})
+	defer stop()
+
+	// Drain a child left over from a prior wakeup before blocking in
+	// epoll_wait again: its eventfd may already read 0 even though it has
+	// more signaled frames buffered (see the Pool doc comment).
+	if id, ok := p.takePending(); ok {
+		return p.recvFrom(id)
+	}
+
+	events := make([]unix.EpollEvent, 1)
+	for {
+		n, err := unix.EpollWait(p.epfd, events, -1)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return 0, nil, err
+		}
+		if n == 0 {
+			continue
+		}
+
+		id := int(events[0].Fd)
+		if id == cancelEventID {
+			var buf [8]byte
+			unix.Read(p.cancelFd, buf[:])
+			return 0, nil, ctx.Err()
+		}
+
+		return p.recvFrom(id)
+	}
+}
+
+// takePending removes and returns an arbitrary child ID left in pending by
+// a previous Wait call, if any.
+func (p *Pool) takePending() (id int, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id := range p.pending {
+		delete(p.pending, id)
+		return id, true
+	}
+	return 0, false
+}
+
+// recvFrom reads one frame from the child registered under id and, if it
+// left further signaled frames buffered, marks id pending so the next
+// Wait call drains them without going back through epoll_wait.
+func (p *Pool) recvFrom(id int) (int, []byte, error) {
+	p.mu.Lock()
+	child := p.children[id]
+	p.mu.Unlock()
+	if child == nil {
+		return id, nil, fmt.Errorf("efd: no child registered with id %d", id)
+	}
+
+	frame, err := child.RecvFrame()
+
+	p.mu.Lock()
+	if child.c2pAvail > 0 {
+		p.pending[id] = struct{}{}
+	} else {
+		delete(p.pending, id)
+	}
+	p.mu.Unlock()
+
+	return id, frame.Payload, err
+}
+
+// SendTo sends data to the child registered under id (P2C).
+func (p *Pool) SendTo(id int, data []byte) error {
+	p.mu.Lock()
+	child := p.children[id]
+	p.mu.Unlock()
+
+	if child == nil {
+		return fmt.Errorf("efd: no child registered with id %d", id)
+	}
+	return child.SendFrame(TypeData, data)
+}
+
+// Broadcast sends data to every child currently in the pool (P2C).
+func (p *Pool) Broadcast(data []byte) error {
+	p.mu.Lock()
+	children := make([]*ShmParent, 0, len(p.children))
+	for _, child := range p.children {
+		children = append(children, child)
+	}
+	p.mu.Unlock()
+
+	for _, child := range children {
+		if err := child.SendFrame(TypeData, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops every child in the pool and releases the epoll instance.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, child := range p.children {
+		child.Close()
+	}
+	unix.Close(p.cancelFd)
+	return unix.Close(p.epfd)
+}
@@ -0,0 +1,78 @@
+//go:build linux
+
+package efd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newTestPool(children map[int]*ShmParent) *Pool {
+	return &Pool{
+		children: children,
+		pending:  make(map[int]struct{}),
+	}
+}
+
+// TestPoolRecvFromDrainsBufferedFramesAcrossCalls is a regression test for
+// the epoll/credit deadlock: recvFrom must keep a child marked pending as
+// long as RecvFrame left more signaled frames buffered, since a single
+// eventfd Wait can drain a count greater than one and epoll won't fire
+// again for frames already accounted for.
+func TestPoolRecvFromDrainsBufferedFramesAcrossCalls(t *testing.T) {
+	const id = 7
+	const credits = 3
+	child := newLoopbackParent(frameHeaderLen+4, credits)
+
+	want := [][]byte{[]byte("aaaa"), []byte("bbbb"), []byte("cccc")}
+	for i, payload := range want {
+		if err := child.SendFrame(TypeData, payload); err != nil {
+			t.Fatalf("SendFrame %d: %v", i, err)
+		}
+	}
+
+	p := newTestPool(map[int]*ShmParent{id: child})
+
+	for i, payload := range want {
+		gotID, data, err := p.recvFrom(id)
+		if err != nil {
+			t.Fatalf("recvFrom %d: %v", i, err)
+		}
+		if gotID != id {
+			t.Fatalf("recvFrom %d returned id %d, want %d", i, gotID, id)
+		}
+		if !bytes.Equal(data, payload) {
+			t.Fatalf("recvFrom %d payload = %q, want %q", i, data, payload)
+		}
+
+		_, stillPending := p.pending[id]
+		wantPending := i < len(want)-1
+		if stillPending != wantPending {
+			t.Fatalf("after recvFrom %d: pending[%d] = %v, want %v", i, id, stillPending, wantPending)
+		}
+	}
+}
+
+func TestPoolTakePending(t *testing.T) {
+	p := newTestPool(nil)
+
+	if _, ok := p.takePending(); ok {
+		t.Fatal("takePending: expected no pending child, got one")
+	}
+
+	p.pending[3] = struct{}{}
+	id, ok := p.takePending()
+	if !ok || id != 3 {
+		t.Fatalf("takePending = (%d, %v), want (3, true)", id, ok)
+	}
+	if _, ok := p.pending[3]; ok {
+		t.Fatal("takePending: expected the entry to be removed from pending")
+	}
+}
+
+func TestPoolRecvFromUnknownChild(t *testing.T) {
+	p := newTestPool(nil)
+	if _, _, err := p.recvFrom(99); err == nil {
+		t.Fatal("recvFrom: expected an error for an unregistered child id, got nil")
+	}
+}
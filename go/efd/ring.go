@@ -0,0 +1,364 @@
+package efd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"unsafe"
+)
+
+// cacheLineSize is the assumed CPU cache line size used to pad the ring
+// header so the producer's tail writes and the consumer's head writes
+// never share a line.
+const cacheLineSize = 64
+
+// ringHeader is the fixed control block at the front of a ring's shared
+// region. head and tail are monotonically increasing byte offsets into the
+// arena (actual position is the offset modulo the arena size); the
+// producer only ever writes tail, the consumer only ever writes head.
+type ringHeader struct {
+	head uint64
+	_    [cacheLineSize - 8]byte
+	tail uint64
+	_    [cacheLineSize - 8]byte
+	mask uint64
+	_    [cacheLineSize - 8]byte
+}
+
+const ringHeaderSize = int(unsafe.Sizeof(ringHeader{}))
+
+// frameHeaderSize is the length prefix written before every frame in the
+// arena.
+const frameHeaderSize = 4
+
+// ringBuffer is a lock-free SPSC ring buffer over a byte arena: a
+// length-prefixed frame protocol on top of a power-of-two circular
+// buffer. It has no knowledge of wake-ups; callers combine it with a
+// Transport to block when empty/full.
+type ringBuffer struct {
+	header *ringHeader
+	arena  []byte
+	mask   uint64
+}
+
+// newRingBuffer lays a ringBuffer over shm, which must be at least
+// ringHeaderSize+arenaSize bytes (as returned by Transport.MapShared).
+// arenaSize must be a power of two.
+func newRingBuffer(shm []byte, arenaSize int) (*ringBuffer, error) {
+	if arenaSize <= 0 || arenaSize&(arenaSize-1) != 0 {
+		return nil, fmt.Errorf("efd: ring arena size %d must be a power of two", arenaSize)
+	}
+	if len(shm) < ringHeaderSize+arenaSize {
+		return nil, fmt.Errorf("efd: shared region too small for a %d-byte ring arena", arenaSize)
+	}
+
+	header := (*ringHeader)(unsafe.Pointer(&shm[0]))
+	mask := uint64(arenaSize - 1)
+	atomic.StoreUint64(&header.mask, mask)
+
+	return &ringBuffer{
+		header: header,
+		arena:  shm[ringHeaderSize : ringHeaderSize+arenaSize],
+		mask:   mask,
+	}, nil
+}
+
+// push appends a length-prefixed frame to the ring. mightBeBlocked
+// reports whether the consumer was caught up (head == tail) right before
+// this write, i.e. whether it may be blocked waiting and needs a wakeup.
+func (r *ringBuffer) push(data []byte) (mightBeBlocked bool, err error) {
+	frameLen := uint64(frameHeaderSize + len(data))
+
+	tail := atomic.LoadUint64(&r.header.tail)
+	head := atomic.LoadUint64(&r.header.head)
+	mightBeBlocked = head == tail
+
+	if tail-head+frameLen > uint64(len(r.arena)) {
+		return false, fmt.Errorf("efd: ring buffer full")
+	}
+
+	var lenBuf [frameHeaderSize]byte
+	binary.NativeEndian.PutUint32(lenBuf[:], uint32(len(data)))
+	r.writeAt(tail, lenBuf[:])
+	r.writeAt(tail+frameHeaderSize, data)
+
+	// Release fence: the consumer must see the frame bytes above before
+	// it sees this advance.
+	atomic.StoreUint64(&r.header.tail, tail+frameLen)
+	return mightBeBlocked, nil
+}
+
+// pop removes and returns the next frame, or ok=false if the ring is
+// currently empty.
+func (r *ringBuffer) pop() (data []byte, ok bool) {
+	head := atomic.LoadUint64(&r.header.head)
+	// Acquire fence: pairs with push's release store on tail.
+	tail := atomic.LoadUint64(&r.header.tail)
+	if head == tail {
+		return nil, false
+	}
+
+	var lenBuf [frameHeaderSize]byte
+	r.readAt(head, lenBuf[:])
+	length := binary.NativeEndian.Uint32(lenBuf[:])
+
+	data = make([]byte, length)
+	r.readAt(head+frameHeaderSize, data)
+
+	atomic.StoreUint64(&r.header.head, head+frameHeaderSize+uint64(length))
+	return data, true
+}
+
+func (r *ringBuffer) writeAt(pos uint64, data []byte) {
+	offset := pos & r.mask
+	n := copy(r.arena[offset:], data)
+	if n < len(data) {
+		copy(r.arena, data[n:])
+	}
+}
+
+func (r *ringBuffer) readAt(pos uint64, data []byte) {
+	offset := pos & r.mask
+	n := copy(data, r.arena[offset:])
+	if n < len(data) {
+		copy(data[n:], r.arena)
+	}
+}
+
+// RingParent is a ring-buffer alternative to ShmParent: P2C and C2P are
+// each a ringBuffer laid out in shared memory, with the underlying
+// Transport's Signal/Wait used only as a wake-up for a peer that might be
+// blocked, never as a per-message ack. This coalesces many sends into a
+// single wakeup syscall pair instead of ShmParent's one-ack-per-message
+// round trip.
+type RingParent struct {
+	childPath string
+	arenaSize int
+	opts      *shmOptions
+
+	p2cTransport Transport
+	c2pTransport Transport
+
+	p2c *ringBuffer
+	c2p *ringBuffer
+
+	cmd *exec.Cmd
+}
+
+// NewRingParent creates a new RingParent. arenaSize is the byte capacity
+// of each direction's ring (excluding the header) and must be a power of
+// two.
+func NewRingParent(childPath string, arenaSize int, opts ...Option) (*RingParent, error) {
+	if arenaSize <= 0 || arenaSize&(arenaSize-1) != 0 {
+		return nil, fmt.Errorf("efd: ring arena size %d must be a power of two", arenaSize)
+	}
+
+	o := defaultShmOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return &RingParent{
+		childPath: childPath,
+		arenaSize: arenaSize,
+		opts:      o,
+	}, nil
+}
+
+// Start launches the child process and sets up the rings.
+func (p *RingParent) Start() error {
+	var err error
+
+	if p.p2cTransport, err = p.opts.newTransport(); err != nil {
+		return fmt.Errorf("failed to create p2c transport: %w", err)
+	}
+	p2cShm, err := p.p2cTransport.MapShared("efdstream_ring_p2c", ringHeaderSize+p.arenaSize)
+	if err != nil {
+		return fmt.Errorf("failed to map p2c ring: %w", err)
+	}
+	if p.p2c, err = newRingBuffer(p2cShm, p.arenaSize); err != nil {
+		return err
+	}
+
+	if p.c2pTransport, err = p.opts.newTransport(); err != nil {
+		return fmt.Errorf("failed to create c2p transport: %w", err)
+	}
+	c2pShm, err := p.c2pTransport.MapShared("efdstream_ring_c2p", ringHeaderSize+p.arenaSize)
+	if err != nil {
+		return fmt.Errorf("failed to map c2p ring: %w", err)
+	}
+	if p.c2p, err = newRingBuffer(c2pShm, p.arenaSize); err != nil {
+		return err
+	}
+
+	p.cmd = exec.Command(p.childPath,
+		"-mode", "child",
+		"-ring-size", fmt.Sprintf("%d", p.arenaSize),
+	)
+	p.cmd.Stdout = os.Stdout
+	p.cmd.Stderr = os.Stderr
+
+	p.cmd.Args = append(p.cmd.Args,
+		"-ring-p2c", strings.Join(p.p2cTransport.PassToChild(p.cmd), ","),
+		"-ring-c2p", strings.Join(p.c2pTransport.PassToChild(p.cmd), ","),
+	)
+
+	if err := p.cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start child: %w", err)
+	}
+
+	return nil
+}
+
+// Send writes data to the P2C ring, waking the child only if it observed
+// the ring empty right before this write.
+func (p *RingParent) Send(data []byte) error {
+	mightBeBlocked, err := p.p2c.push(data)
+	if err != nil {
+		return err
+	}
+	if mightBeBlocked {
+		return p.p2cTransport.Signal(1)
+	}
+	return nil
+}
+
+// Recv returns the next frame from the C2P ring, blocking until one is
+// available.
+func (p *RingParent) Recv() ([]byte, error) {
+	for {
+		if data, ok := p.c2p.pop(); ok {
+			return data, nil
+		}
+		if _, err := p.c2pTransport.Wait(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// RecvBatch is the hot-path alternative to calling Recv in a loop: it
+// drains every frame currently on the C2P ring into fn before blocking
+// again, so one wakeup can deliver many messages.
+func (p *RingParent) RecvBatch(fn func([]byte)) error {
+	for {
+		for {
+			data, ok := p.c2p.pop()
+			if !ok {
+				break
+			}
+			fn(data)
+		}
+		if _, err := p.c2pTransport.Wait(); err != nil {
+			return err
+		}
+	}
+}
+
+// Close cleans up resources.
+func (p *RingParent) Close() {
+	if p.p2cTransport != nil {
+		p.p2cTransport.Close()
+	}
+	if p.c2pTransport != nil {
+		p.c2pTransport.Close()
+	}
+	if p.cmd != nil && p.cmd.Process != nil {
+		p.cmd.Process.Kill()
+	}
+}
+
+// RingChild is the child side of a RingParent connection.
+type RingChild struct {
+	p2cTransport Transport
+	c2pTransport Transport
+
+	p2c *ringBuffer
+	c2p *ringBuffer
+}
+
+// NewRingChild reconstructs the P2C and C2P rings from FDs inherited from
+// a RingParent, matching the arenaSize it was started with.
+func NewRingChild(p2cFds, c2pFds []int, arenaSize int) (*RingChild, error) {
+	size := ringHeaderSize + arenaSize
+
+	p2cTransport, p2cShm, err := newChildTransport(p2cFds, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach p2c ring transport: %w", err)
+	}
+	p2c, err := newRingBuffer(p2cShm, arenaSize)
+	if err != nil {
+		return nil, err
+	}
+
+	c2pTransport, c2pShm, err := newChildTransport(c2pFds, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach c2p ring transport: %w", err)
+	}
+	c2p, err := newRingBuffer(c2pShm, arenaSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RingChild{
+		p2cTransport: p2cTransport,
+		c2pTransport: c2pTransport,
+		p2c:          p2c,
+		c2p:          c2p,
+	}, nil
+}
+
+// Recv returns the next frame sent by the parent (P2C), blocking until one
+// is available.
+func (c *RingChild) Recv() ([]byte, error) {
+	for {
+		if data, ok := c.p2c.pop(); ok {
+			return data, nil
+		}
+		if _, err := c.p2cTransport.Wait(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// RecvBatch drains every frame currently on the P2C ring into fn before
+// blocking again.
+func (c *RingChild) RecvBatch(fn func([]byte)) error {
+	for {
+		for {
+			data, ok := c.p2c.pop()
+			if !ok {
+				break
+			}
+			fn(data)
+		}
+		if _, err := c.p2cTransport.Wait(); err != nil {
+			return err
+		}
+	}
+}
+
+// Send writes data to the C2P ring, waking the parent only if it observed
+// the ring empty right before this write.
+func (c *RingChild) Send(data []byte) error {
+	mightBeBlocked, err := c.c2p.push(data)
+	if err != nil {
+		return err
+	}
+	if mightBeBlocked {
+		return c.c2pTransport.Signal(1)
+	}
+	return nil
+}
+
+// Close cleans up resources.
+func (c *RingChild) Close() {
+	if c.p2cTransport != nil {
+		c.p2cTransport.Close()
+	}
+	if c.c2pTransport != nil {
+		c.c2pTransport.Close()
+	}
+}
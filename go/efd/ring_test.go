@@ -0,0 +1,97 @@
+package efd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newTestRing(t *testing.T, arenaSize int) *ringBuffer {
+	t.Helper()
+	shm := make([]byte, ringHeaderSize+arenaSize)
+	r, err := newRingBuffer(shm, arenaSize)
+	if err != nil {
+		t.Fatalf("newRingBuffer: %v", err)
+	}
+	return r
+}
+
+func TestRingBufferPushPop(t *testing.T) {
+	r := newTestRing(t, 16)
+
+	want := []byte("hi")
+	if _, err := r.push(want); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	got, ok := r.pop()
+	if !ok {
+		t.Fatal("pop: ring unexpectedly empty")
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("pop = %q, want %q", got, want)
+	}
+
+	if _, ok := r.pop(); ok {
+		t.Fatal("pop: expected empty ring after draining the only frame")
+	}
+}
+
+func TestRingBufferWraparound(t *testing.T) {
+	// Each two-byte frame takes frameHeaderSize+2 = 6 bytes; an 8-byte arena
+	// holds one at a time, so repeatedly pushing and popping walks tail
+	// and head past the end of the arena and back to the start, the same
+	// way a long-running producer/consumer pair would.
+	r := newTestRing(t, 8)
+
+	for i := 0; i < 10; i++ {
+		want := []byte{byte(i), byte(i + 1)}
+		if _, err := r.push(want); err != nil {
+			t.Fatalf("push %d: %v", i, err)
+		}
+		got, ok := r.pop()
+		if !ok {
+			t.Fatalf("pop %d: ring unexpectedly empty", i)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("pop %d = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestRingBufferFull(t *testing.T) {
+	r := newTestRing(t, 8)
+
+	if _, err := r.push([]byte{1, 2}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if _, err := r.push([]byte{3, 4}); err == nil {
+		t.Fatal("push: expected error on a full ring, got nil")
+	}
+}
+
+func TestRingBufferMightBeBlocked(t *testing.T) {
+	r := newTestRing(t, 64)
+
+	mightBeBlocked, err := r.push([]byte("a"))
+	if err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if !mightBeBlocked {
+		t.Fatal("push into an empty ring: mightBeBlocked = false, want true")
+	}
+
+	mightBeBlocked, err = r.push([]byte("b"))
+	if err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if mightBeBlocked {
+		t.Fatal("push into a non-empty ring: mightBeBlocked = true, want false")
+	}
+}
+
+func TestNewRingBufferRejectsNonPowerOfTwo(t *testing.T) {
+	shm := make([]byte, ringHeaderSize+100)
+	if _, err := newRingBuffer(shm, 100); err == nil {
+		t.Fatal("newRingBuffer: expected error for a non-power-of-two arena size, got nil")
+	}
+}
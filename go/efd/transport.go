@@ -0,0 +1,99 @@
+package efd
+
+import "os/exec"
+
+// nextChildFd returns the FD number the next entry appended to
+// cmd.ExtraFiles will have inside the child, following exec.Cmd's
+// convention of mapping ExtraFiles[i] to FD 3+i. Transport implementations
+// use this when building the PassToChild argument list.
+func nextChildFd(cmd *exec.Cmd) int {
+	return 3 + len(cmd.ExtraFiles)
+}
+
+// Transport abstracts the OS-specific primitives a single efd signaling
+// channel needs: a way to wake the peer, a way to block until woken, a
+// shared memory mapping, and a way to hand the underlying handles down to
+// a child process. Each direction of a channel (e.g. the P2C "data ready"
+// signal and its ack) owns one Transport.
+//
+// Implementations are platform-specific (see transport_linux.go,
+// transport_bsd.go, transport_windows.go) and are never used concurrently
+// by more than one producer and one consumer, matching the rest of this
+// package's single-producer/single-consumer assumptions.
+type Transport interface {
+	// Signal wakes the peer blocked in Wait. n is added to the value the
+	// next Wait returns; ShmParent/ShmChild use it to carry a frame count
+	// (or a credit grant), and Channel uses it to carry a byte length.
+	Signal(n uint64) error
+
+	// Wait blocks until the peer calls Signal and returns the value it
+	// was given.
+	Wait() (uint64, error)
+
+	// MapShared creates (or opens) a shared memory region of size bytes
+	// identified by name and returns it mapped into this process. name is
+	// only meaningful to the backend (e.g. a memfd name or a temp-file
+	// path prefix; the Windows backend ignores it) and need not be unique
+	// across processes beyond what the backend requires.
+	MapShared(name string, size int) ([]byte, error)
+
+	// PassToChild attaches whatever OS handles this transport owns to
+	// cmd so the child can recover them after exec, and returns the
+	// extra command-line arguments the child needs in order to do so
+	// (e.g. ExtraFiles indices or inherited handle values).
+	PassToChild(cmd *exec.Cmd) []string
+
+	// Close releases all resources owned by the transport.
+	Close() error
+}
+
+// newTransport returns a fresh Transport using the default backend for the
+// current platform (eventfd+memfd on Linux, kqueue+an unlinked mmap'd temp
+// file on Darwin and FreeBSD, CreateFileMappingW+Event on Windows).
+func newTransport() (Transport, error) {
+	return newPlatformTransport()
+}
+
+// TransportFactory creates a new Transport instance. ShmParent calls it
+// once per signaling direction it needs, so a factory must be safe to call
+// more than once and must return independent Transports each time.
+type TransportFactory func() (Transport, error)
+
+// shmOptions holds the configuration assembled by Option values passed to
+// NewShmParent.
+type shmOptions struct {
+	newTransport TransportFactory
+	credits      int
+}
+
+// Option configures a ShmParent at construction time.
+type Option func(*shmOptions)
+
+// WithTransport overrides the default platform Transport backend (which
+// is already the kqueue or Windows implementation on those hosts), e.g. so
+// tests can substitute an in-memory fake.
+func WithTransport(factory TransportFactory) Option {
+	return func(o *shmOptions) {
+		o.newTransport = factory
+	}
+}
+
+// Credits sets how many P2C/C2P frames may be in flight before the sender
+// blocks waiting for the receiver to return a batch of credits, instead of
+// blocking on an ack after every single message. The receiver returns
+// credits in one eventfd write per full window, so Credits(n) costs one
+// ack syscall pair per n messages instead of one per message; each frame
+// still gets its own data Signal.
+// Credits(1) reproduces the original strict send-then-ack behavior.
+func Credits(n int) Option {
+	return func(o *shmOptions) {
+		o.credits = n
+	}
+}
+
+func defaultShmOptions() *shmOptions {
+	return &shmOptions{
+		newTransport: newTransport,
+		credits:      1,
+	}
+}
@@ -0,0 +1,215 @@
+//go:build darwin || freebsd
+
+package efd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// kqueueTransport is the default Transport on Darwin and FreeBSD. It uses
+// a shared kqueue descriptor with an EVFILT_USER event for signaling
+// (inherited kqueue fds let the child trigger the same kernel object the
+// parent blocks on) and an unlinked temp file, ftruncated and mmap'd (see
+// anonShared), for the shared region.
+//
+// EVFILT_USER is a FreeBSD/Darwin/Dragonfly kqueue extension; OpenBSD and
+// NetBSD's kqueue don't implement it, so this file intentionally doesn't
+// build there. Those platforms would need a different wake-up primitive
+// (e.g. a self-pipe registered with EVFILT_READ) and have no Transport yet.
+//
+// EVFILT_USER carries no payload, so the Signal/Wait value is accumulated
+// in a word at the front of a small control mapping created alongside the
+// kqueue. Signal adds rather than stores into it and Wait reads-and-resets
+// it, the same summing behavior Linux gets for free from eventfd; without
+// that, two Signal(1) calls before a single Wait (exactly what
+// Credits(n>1) does) would collapse into the one EVFILT_USER trigger
+// that's still pending and silently lose a frame.
+type kqueueTransport struct {
+	kq     int
+	kqFile *os.File
+
+	ctrlFile *os.File
+	ctrl     []byte // 8 bytes, holds the pending Signal value
+
+	shmFile *os.File
+	shm     []byte
+}
+
+const kqueueUserIdent = 1
+
+func newPlatformTransport() (Transport, error) {
+	kq, err := unix.Kqueue()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kqueue: %w", err)
+	}
+
+	reg := []unix.Kevent_t{{
+		Ident:  kqueueUserIdent,
+		Filter: unix.EVFILT_USER,
+		Flags:  unix.EV_ADD | unix.EV_CLEAR,
+	}}
+	if _, err := unix.Kevent(kq, reg, nil, nil); err != nil {
+		unix.Close(kq)
+		return nil, fmt.Errorf("failed to register user event: %w", err)
+	}
+
+	ctrlFile, ctrl, err := anonShared("efdstream_ctrl", 8)
+	if err != nil {
+		unix.Close(kq)
+		return nil, err
+	}
+
+	return &kqueueTransport{
+		kq:       kq,
+		kqFile:   os.NewFile(uintptr(kq), "efd_kqueue"),
+		ctrlFile: ctrlFile,
+		ctrl:     ctrl,
+	}, nil
+}
+
+func (t *kqueueTransport) Signal(n uint64) error {
+	atomic.AddUint64(byteSliceWord(t.ctrl), n)
+
+	changes := []unix.Kevent_t{{
+		Ident:  kqueueUserIdent,
+		Filter: unix.EVFILT_USER,
+		Fflags: unix.NOTE_TRIGGER,
+	}}
+	_, err := unix.Kevent(t.kq, changes, nil, nil)
+	return err
+}
+
+func (t *kqueueTransport) Wait() (uint64, error) {
+	events := make([]unix.Kevent_t, 1)
+	for {
+		n, err := unix.Kevent(t.kq, nil, events, nil)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return 0, err
+		}
+		if n > 0 {
+			break
+		}
+	}
+	return atomic.SwapUint64(byteSliceWord(t.ctrl), 0), nil
+}
+
+func (t *kqueueTransport) MapShared(name string, size int) ([]byte, error) {
+	shmFile, shm, err := anonShared(name, size)
+	if err != nil {
+		return nil, err
+	}
+	t.shmFile = shmFile
+	t.shm = shm
+	return shm, nil
+}
+
+// PassToChild hands the kqueue, control mapping, and (if created) the
+// shared memory region to the child and returns the resulting FD numbers.
+func (t *kqueueTransport) PassToChild(cmd *exec.Cmd) []string {
+	args := []string{
+		strconv.Itoa(nextChildFd(cmd)),
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, t.kqFile)
+
+	args = append(args, strconv.Itoa(nextChildFd(cmd)))
+	cmd.ExtraFiles = append(cmd.ExtraFiles, t.ctrlFile)
+
+	if t.shmFile != nil {
+		args = append(args, strconv.Itoa(nextChildFd(cmd)))
+		cmd.ExtraFiles = append(cmd.ExtraFiles, t.shmFile)
+	}
+
+	return args
+}
+
+func (t *kqueueTransport) Close() error {
+	if t.shm != nil {
+		unix.Munmap(t.shm)
+	}
+	if t.ctrl != nil {
+		unix.Munmap(t.ctrl)
+	}
+	return t.kqFile.Close()
+}
+
+// newChildTransport reconstructs a Transport from FDs inherited via
+// ExtraFiles, in the order kqueueTransport.PassToChild emitted them: the
+// shared kqueue, the control mapping, and (when shmSize > 0) the shared
+// memory region.
+func newChildTransport(fds []int, shmSize int) (Transport, []byte, error) {
+	if len(fds) < 2 {
+		return nil, nil, fmt.Errorf("efd: expected at least 2 fds (kqueue, ctrl), got %d", len(fds))
+	}
+
+	ctrl, err := unix.Mmap(fds[1], 0, 8, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to mmap inherited ctrl word: %w", err)
+	}
+	t := &kqueueTransport{
+		kq:       fds[0],
+		kqFile:   os.NewFile(uintptr(fds[0]), "efd_kqueue"),
+		ctrlFile: os.NewFile(uintptr(fds[1]), "efd_ctrl"),
+		ctrl:     ctrl,
+	}
+
+	if shmSize == 0 {
+		return t, nil, nil
+	}
+	if len(fds) < 3 {
+		return nil, nil, fmt.Errorf("efd: expected a shm fd alongside kqueue+ctrl")
+	}
+	shm, err := unix.Mmap(fds[2], 0, shmSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to mmap inherited shm: %w", err)
+	}
+	t.shmFile = os.NewFile(uintptr(fds[2]), "efd_shm")
+	t.shm = shm
+	return t, shm, nil
+}
+
+// anonShared approximates POSIX shm_open: x/sys/unix doesn't wrap shm_open
+// on the BSD family, but opening a fresh tmpfs-backed path, ftruncating it,
+// mmap'ing it MAP_SHARED, then unlinking the name achieves the same
+// result — an anonymous region kept alive only by the open FD and its
+// mapping, which is exactly what the inherited-FD handoff to the child
+// needs.
+func anonShared(name string, size int) (*os.File, []byte, error) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("%s_%d_%p", name, os.Getpid(), &name))
+
+	fd, err := unix.Open(path, unix.O_CREAT|unix.O_RDWR, 0600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open shared region %s: %w", path, err)
+	}
+	defer unix.Unlink(path)
+
+	if err := unix.Ftruncate(fd, int64(size)); err != nil {
+		unix.Close(fd)
+		return nil, nil, fmt.Errorf("failed to ftruncate shared region: %w", err)
+	}
+
+	mem, err := unix.Mmap(fd, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		unix.Close(fd)
+		return nil, nil, fmt.Errorf("failed to mmap shared region: %w", err)
+	}
+
+	return os.NewFile(uintptr(fd), name), mem, nil
+}
+
+// byteSliceWord reinterprets the first 8 bytes of b as a *uint64 for
+// atomic access. b must be at least 8 bytes and 8-byte aligned, which mmap
+// always returns.
+func byteSliceWord(b []byte) *uint64 {
+	return (*uint64)(unsafe.Pointer(&b[0]))
+}
@@ -0,0 +1,120 @@
+//go:build linux
+
+package efd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// eventfdTransport is the default Linux Transport: an eventfd for
+// signaling and, once MapShared is called, a memfd-backed shared mapping.
+type eventfdTransport struct {
+	efd  int
+	file *os.File
+
+	memfd int
+	shm   []byte
+}
+
+func newPlatformTransport() (Transport, error) {
+	fd, err := unix.Eventfd(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create eventfd: %w", err)
+	}
+	return &eventfdTransport{
+		efd:  fd,
+		file: os.NewFile(uintptr(fd), "efd"),
+	}, nil
+}
+
+func (t *eventfdTransport) Signal(n uint64) error {
+	var buf [8]byte
+	binary.NativeEndian.PutUint64(buf[:], n)
+	_, err := t.file.Write(buf[:])
+	return err
+}
+
+func (t *eventfdTransport) Wait() (uint64, error) {
+	var buf [8]byte
+	if _, err := t.file.Read(buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.NativeEndian.Uint64(buf[:]), nil
+}
+
+func (t *eventfdTransport) MapShared(name string, size int) ([]byte, error) {
+	memfd, err := unix.MemfdCreate(name, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create memfd: %w", err)
+	}
+	if err := unix.Ftruncate(memfd, int64(size)); err != nil {
+		unix.Close(memfd)
+		return nil, fmt.Errorf("failed to ftruncate memfd: %w", err)
+	}
+	shm, err := unix.Mmap(memfd, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		unix.Close(memfd)
+		return nil, fmt.Errorf("failed to mmap shared region: %w", err)
+	}
+	t.memfd = memfd
+	t.shm = shm
+	return shm, nil
+}
+
+// PassToChild appends the eventfd and (if MapShared was called) the memfd
+// to cmd.ExtraFiles and returns the resulting FD numbers as strings so the
+// child can be told which FD is which via flags, matching the convention
+// used by ShmParent.Start.
+func (t *eventfdTransport) PassToChild(cmd *exec.Cmd) []string {
+	args := []string{strconv.Itoa(nextChildFd(cmd))}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, t.file)
+
+	if t.memfd != 0 {
+		memfdFile := os.NewFile(uintptr(t.memfd), "efd_shm")
+		args = append(args, strconv.Itoa(nextChildFd(cmd)))
+		cmd.ExtraFiles = append(cmd.ExtraFiles, memfdFile)
+	}
+
+	return args
+}
+
+func (t *eventfdTransport) Close() error {
+	if t.shm != nil {
+		unix.Munmap(t.shm)
+	}
+	return t.file.Close()
+}
+
+// newChildTransport reconstructs a Transport from FDs inherited via
+// ExtraFiles, in the order eventfdTransport.PassToChild emitted them. When
+// shmSize is 0 the channel carries no shared memory (an ack-only channel)
+// and fds is expected to hold just the eventfd.
+func newChildTransport(fds []int, shmSize int) (Transport, []byte, error) {
+	if len(fds) < 1 {
+		return nil, nil, fmt.Errorf("efd: expected at least 1 fd, got %d", len(fds))
+	}
+	t := &eventfdTransport{
+		efd:  fds[0],
+		file: os.NewFile(uintptr(fds[0]), "efd"),
+	}
+
+	if shmSize == 0 {
+		return t, nil, nil
+	}
+	if len(fds) < 2 {
+		return nil, nil, fmt.Errorf("efd: expected a shm fd alongside the eventfd")
+	}
+	shm, err := unix.Mmap(fds[1], 0, shmSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to mmap inherited shm: %w", err)
+	}
+	t.memfd = fds[1]
+	t.shm = shm
+	return t, shm, nil
+}
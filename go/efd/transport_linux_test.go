@@ -0,0 +1,85 @@
+//go:build linux
+
+package efd
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestEventfdTransportSignalWaitRoundTrip(t *testing.T) {
+	tr, err := newPlatformTransport()
+	if err != nil {
+		t.Fatalf("newPlatformTransport: %v", err)
+	}
+	defer tr.Close()
+
+	if err := tr.Signal(1); err != nil {
+		t.Fatalf("Signal: %v", err)
+	}
+	if err := tr.Signal(1); err != nil {
+		t.Fatalf("Signal: %v", err)
+	}
+
+	n, err := tr.Wait()
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("Wait = %d, want 2 (eventfd sums pending Signal calls)", n)
+	}
+}
+
+func TestEventfdTransportMapShared(t *testing.T) {
+	tr, err := newPlatformTransport()
+	if err != nil {
+		t.Fatalf("newPlatformTransport: %v", err)
+	}
+	defer tr.Close()
+
+	shm, err := tr.MapShared("efdstream_test", 64)
+	if err != nil {
+		t.Fatalf("MapShared: %v", err)
+	}
+	copy(shm, []byte("hello"))
+	if string(shm[:5]) != "hello" {
+		t.Fatalf("shm[:5] = %q, want %q", shm[:5], "hello")
+	}
+}
+
+// TestNewChildTransportReconstructsFromFds exercises the child side of the
+// handoff PassToChild/newChildTransport implement: a real exec'd child only
+// ever sees this reconstruction step, parsing the FD numbers the parent
+// passed down back into a working Transport.
+func TestNewChildTransportReconstructsFromFds(t *testing.T) {
+	tr, err := newPlatformTransport()
+	if err != nil {
+		t.Fatalf("newPlatformTransport: %v", err)
+	}
+	defer tr.Close()
+
+	if _, err := tr.MapShared("efdstream_test_child", 32); err != nil {
+		t.Fatalf("MapShared: %v", err)
+	}
+
+	args := tr.PassToChild(&exec.Cmd{})
+	if len(args) != 2 {
+		t.Fatalf("PassToChild returned %d args, want 2 (eventfd, memfd)", len(args))
+	}
+
+	et := tr.(*eventfdTransport)
+	child, shm, err := newChildTransport([]int{et.efd, et.memfd}, 32)
+	if err != nil {
+		t.Fatalf("newChildTransport: %v", err)
+	}
+	if len(shm) != 32 {
+		t.Fatalf("reconstructed shm len = %d, want 32", len(shm))
+	}
+
+	if err := child.Signal(1); err != nil {
+		t.Fatalf("Signal: %v", err)
+	}
+	if n, err := tr.Wait(); err != nil || n != 1 {
+		t.Fatalf("Wait on the parent's transport after the reconstructed child signaled = (%d, %v), want (1, nil)", n, err)
+	}
+}
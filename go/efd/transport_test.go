@@ -0,0 +1,116 @@
+package efd
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+// fakeTransport is an in-memory Transport, the kind of fake WithTransport's
+// doc comment says it exists to support: it needs no OS primitives, so
+// tests can exercise the option plumbing and the credit/framing logic
+// built on top of Transport without a real eventfd or child process.
+// waitCh models Signal/Wait as an accumulating counter the way eventfd
+// does: each Signal adds to the pending total and Wait drains it all in
+// one call.
+type fakeTransport struct {
+	shm      []byte
+	pending  uint64
+	waitCh   chan struct{}
+	waitErr  error
+	signaled []uint64
+}
+
+func newFakeTransport() *fakeTransport {
+	return &fakeTransport{waitCh: make(chan struct{}, 1)}
+}
+
+func (f *fakeTransport) Signal(n uint64) error {
+	f.signaled = append(f.signaled, n)
+	f.pending += n
+	select {
+	case f.waitCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (f *fakeTransport) Wait() (uint64, error) {
+	if f.waitErr != nil {
+		return 0, f.waitErr
+	}
+	<-f.waitCh
+	n := f.pending
+	f.pending = 0
+	return n, nil
+}
+
+func (f *fakeTransport) MapShared(name string, size int) ([]byte, error) {
+	f.shm = make([]byte, size)
+	return f.shm, nil
+}
+
+func (f *fakeTransport) PassToChild(cmd *exec.Cmd) []string { return nil }
+
+func (f *fakeTransport) Close() error { return nil }
+
+func TestWithTransportOverridesFactory(t *testing.T) {
+	var made []*fakeTransport
+	factory := func() (Transport, error) {
+		tr := newFakeTransport()
+		made = append(made, tr)
+		return tr, nil
+	}
+
+	o := defaultShmOptions()
+	WithTransport(factory)(o)
+
+	tr, err := o.newTransport()
+	if err != nil {
+		t.Fatalf("newTransport: %v", err)
+	}
+	if _, ok := tr.(*fakeTransport); !ok {
+		t.Fatalf("newTransport returned %T, want *fakeTransport", tr)
+	}
+	if len(made) != 1 {
+		t.Fatalf("factory called %d times, want 1", len(made))
+	}
+}
+
+func TestCreditsOption(t *testing.T) {
+	o := defaultShmOptions()
+	if o.credits != 1 {
+		t.Fatalf("default credits = %d, want 1", o.credits)
+	}
+
+	Credits(8)(o)
+	if o.credits != 8 {
+		t.Fatalf("credits after Credits(8) = %d, want 8", o.credits)
+	}
+}
+
+func TestFakeTransportAccumulatesSignals(t *testing.T) {
+	f := newFakeTransport()
+	if err := f.Signal(1); err != nil {
+		t.Fatalf("Signal: %v", err)
+	}
+	if err := f.Signal(1); err != nil {
+		t.Fatalf("Signal: %v", err)
+	}
+
+	n, err := f.Wait()
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("Wait = %d, want 2 (both Signal calls summed)", n)
+	}
+}
+
+func TestFakeTransportWaitError(t *testing.T) {
+	f := newFakeTransport()
+	f.waitErr = errors.New("boom")
+	if _, err := f.Wait(); err == nil {
+		t.Fatal("Wait: expected error, got nil")
+	}
+}
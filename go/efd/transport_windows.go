@@ -0,0 +1,178 @@
+//go:build windows
+
+package efd
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// eventTransport is the default Windows Transport: an unnamed Event object
+// (SetEvent/WaitForSingleObject) for signaling and a file mapping
+// (CreateFileMappingW/MapViewOfFile) for the shared region.
+//
+// Windows Events carry no payload, so the Signal value is accumulated in a
+// dedicated 8-byte control mapping (ctrl), kept separate from the payload
+// mapping (shm) so a Signal never clobbers frame bytes already written
+// there. Signal adds rather than stores into ctrl and Wait reads-and-resets
+// it, the same summing behavior Linux gets for free from eventfd; without
+// that, two Signal(1) calls before a single Wait (exactly what Credits(n>1)
+// does) would collapse into one and silently lose a frame.
+type eventTransport struct {
+	event windows.Handle
+
+	ctrlMapping windows.Handle
+	ctrl        []byte // 8 bytes, accumulates pending Signal values
+
+	mapping windows.Handle
+	shm     []byte
+}
+
+func newPlatformTransport() (Transport, error) {
+	event, err := windows.CreateEvent(nil, 0 /* auto-reset */, 0, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create event: %w", err)
+	}
+
+	ctrlMapping, ctrl, err := createFileMapping(8)
+	if err != nil {
+		windows.CloseHandle(event)
+		return nil, err
+	}
+
+	return &eventTransport{event: event, ctrlMapping: ctrlMapping, ctrl: ctrl}, nil
+}
+
+func (t *eventTransport) Signal(n uint64) error {
+	atomic.AddUint64((*uint64)(unsafe.Pointer(&t.ctrl[0])), n)
+	return windows.SetEvent(t.event)
+}
+
+func (t *eventTransport) Wait() (uint64, error) {
+	rv, err := windows.WaitForSingleObject(t.event, windows.INFINITE)
+	if err != nil {
+		return 0, err
+	}
+	if rv != windows.WAIT_OBJECT_0 {
+		return 0, fmt.Errorf("unexpected wait result: %d", rv)
+	}
+	return atomic.SwapUint64((*uint64)(unsafe.Pointer(&t.ctrl[0])), 0), nil
+}
+
+func (t *eventTransport) MapShared(name string, size int) ([]byte, error) {
+	mapping, shm, err := createFileMapping(size)
+	if err != nil {
+		return nil, err
+	}
+	t.mapping = mapping
+	t.shm = shm
+	return shm, nil
+}
+
+// createFileMapping creates an anonymous, page-file-backed file mapping of
+// size bytes and maps it into this process, for both the ctrl word and the
+// payload region MapShared returns.
+func createFileMapping(size int) (windows.Handle, []byte, error) {
+	mapping, err := windows.CreateFileMapping(
+		windows.InvalidHandle, nil, windows.PAGE_READWRITE, 0, uint32(size), nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create file mapping: %w", err)
+	}
+
+	addr, err := windows.MapViewOfFile(mapping, windows.FILE_MAP_READ|windows.FILE_MAP_WRITE, 0, 0, uintptr(size))
+	if err != nil {
+		windows.CloseHandle(mapping)
+		return 0, nil, fmt.Errorf("failed to map view of file: %w", err)
+	}
+
+	return mapping, unsafe.Slice((*byte)(unsafe.Pointer(addr)), size), nil
+}
+
+// PassToChild marks the event, ctrl, and (if mapped) payload handles as
+// inheritable, adds them to cmd's AdditionalInheritedHandles, and returns
+// their numeric values; Windows handles keep the same numeric value in an
+// inheriting child process, so the child just parses them back into
+// syscall.Handle.
+func (t *eventTransport) PassToChild(cmd *exec.Cmd) []string {
+	windows.SetHandleInformation(t.event, windows.HANDLE_FLAG_INHERIT, windows.HANDLE_FLAG_INHERIT)
+	windows.SetHandleInformation(t.ctrlMapping, windows.HANDLE_FLAG_INHERIT, windows.HANDLE_FLAG_INHERIT)
+
+	args := []string{
+		strconv.FormatUint(uint64(t.event), 10),
+		strconv.FormatUint(uint64(t.ctrlMapping), 10),
+	}
+	handles := []syscall.Handle{syscall.Handle(t.event), syscall.Handle(t.ctrlMapping)}
+
+	if t.mapping != 0 {
+		windows.SetHandleInformation(t.mapping, windows.HANDLE_FLAG_INHERIT, windows.HANDLE_FLAG_INHERIT)
+		args = append(args, strconv.FormatUint(uint64(t.mapping), 10))
+		handles = append(handles, syscall.Handle(t.mapping))
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.AdditionalInheritedHandles = append(cmd.SysProcAttr.AdditionalInheritedHandles, handles...)
+
+	return args
+}
+
+// newChildTransport reconstructs a Transport from handle values inherited
+// from the parent, in the order eventTransport.PassToChild emitted them:
+// the event, the ctrl mapping, and (when shmSize > 0) the payload mapping.
+// Windows handles keep their numeric value across an inheriting child, so
+// handles are the same values PassToChild returned.
+func newChildTransport(handles []int, shmSize int) (Transport, []byte, error) {
+	if len(handles) < 2 {
+		return nil, nil, fmt.Errorf("efd: expected at least 2 handles (event, ctrl), got %d", len(handles))
+	}
+
+	ctrlMapping := windows.Handle(handles[1])
+	ctrlAddr, err := windows.MapViewOfFile(ctrlMapping, windows.FILE_MAP_READ|windows.FILE_MAP_WRITE, 0, 0, 8)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to map inherited ctrl word: %w", err)
+	}
+	t := &eventTransport{
+		event:       windows.Handle(handles[0]),
+		ctrlMapping: ctrlMapping,
+		ctrl:        unsafe.Slice((*byte)(unsafe.Pointer(ctrlAddr)), 8),
+	}
+
+	if shmSize == 0 {
+		return t, nil, nil
+	}
+	if len(handles) < 3 {
+		return nil, nil, fmt.Errorf("efd: expected a mapping handle alongside the event+ctrl")
+	}
+	mapping := windows.Handle(handles[2])
+	addr, err := windows.MapViewOfFile(mapping, windows.FILE_MAP_READ|windows.FILE_MAP_WRITE, 0, 0, uintptr(shmSize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to map inherited view: %w", err)
+	}
+	shm := unsafe.Slice((*byte)(unsafe.Pointer(addr)), shmSize)
+	t.mapping = mapping
+	t.shm = shm
+	return t, shm, nil
+}
+
+func (t *eventTransport) Close() error {
+	if t.shm != nil {
+		windows.UnmapViewOfFile(uintptr(unsafe.Pointer(&t.shm[0])))
+	}
+	if t.mapping != 0 {
+		windows.CloseHandle(t.mapping)
+	}
+	if t.ctrl != nil {
+		windows.UnmapViewOfFile(uintptr(unsafe.Pointer(&t.ctrl[0])))
+	}
+	if t.ctrlMapping != 0 {
+		windows.CloseHandle(t.ctrlMapping)
+	}
+	return windows.CloseHandle(t.event)
+}